@@ -0,0 +1,422 @@
+// Package builder assembles Edge blocks from the txpool on behalf of a
+// sequencer, recommitting the in-flight block as better transactions arrive
+// so that a busy pool doesn't get frozen out by whatever happened to be at
+// the front of the queue when our turn started.
+package builder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/0xPolygon/polygon-edge/blockchain"
+	"github.com/0xPolygon/polygon-edge/consensus"
+	"github.com/0xPolygon/polygon-edge/state"
+	"github.com/0xPolygon/polygon-edge/txpool"
+	"github.com/0xPolygon/polygon-edge/types"
+	stypes "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/hashicorp/go-hclog"
+	"github.com/maticnetwork/avail-settlement/pkg/avail"
+	"github.com/maticnetwork/avail-settlement/pkg/block"
+)
+
+const (
+	// DefaultRecommitInterval is how often the in-flight block is rebuilt
+	// from the current state of the txpool while a build is in progress.
+	DefaultRecommitInterval = 3 * time.Second
+
+	// minRecommitInterval/maxRecommitInterval bound the adaptive interval so
+	// it never spins hot on an empty pool or goes stale on a full one.
+	minRecommitInterval = 500 * time.Millisecond
+	maxRecommitInterval = 10 * time.Second
+
+	// targetGasUsageRatio is the fraction of the block gas limit a previous
+	// block needed to hit before we widen the recommit interval again.
+	targetGasUsageRatio = 0.9
+
+	// previewScanLimit bounds how many transactions Preview walks, as a
+	// defensive backstop against looping forever if Demote ever stopped
+	// reordering the pool's iterator the way it's expected to.
+	previewScanLimit = 4096
+)
+
+// transitionInterface is the subset of *state.Transition the builder needs,
+// mirroring the one SequencerWorker used to depend on directly.
+type transitionInterface interface {
+	Write(txn *types.Transaction) error
+}
+
+// Config controls how a Builder paces recommits within a single slot.
+type Config struct {
+	// BlockTime is the minimum spacing between parent and child block
+	// timestamps; it also bounds how long a build may run for.
+	BlockTime time.Duration
+
+	// RecommitInterval is the starting interval between rebuilds of the
+	// in-flight block. Zero uses DefaultRecommitInterval.
+	RecommitInterval time.Duration
+}
+
+// Builder assembles a single Edge block at a time, rebuilding it against the
+// latest txpool state on a timer or whenever a better transaction shows up,
+// until the slot deadline is reached or the pool drains.
+type Builder struct {
+	logger      hclog.Logger
+	blockchain  *blockchain.Blockchain
+	executor    *state.Executor
+	txpool      *txpool.TxPool
+	availSender avail.Sender
+	nodeType    string
+
+	blockTime        time.Duration
+	recommitInterval time.Duration
+
+	newTxCh chan struct{}
+
+	// txpoolMu serializes every Prepare/Peek/Pop/Drop/Demote sequence
+	// against the pool, whether it comes from the real recommit loop or
+	// from Preview. Both walk the same Prepare()-built iterator, so letting
+	// them interleave would corrupt each other's view of it.
+	txpoolMu sync.Mutex
+}
+
+// New creates a Builder. nodeType is written alongside each block that's
+// committed to the local blockchain, matching blockchain.WriteBlock's
+// existing "source" argument.
+func New(logger hclog.Logger, b *blockchain.Blockchain, e *state.Executor, txp *txpool.TxPool, availSender avail.Sender, nodeType string, cfg Config) *Builder {
+	recommitInterval := cfg.RecommitInterval
+	if recommitInterval <= 0 {
+		recommitInterval = DefaultRecommitInterval
+	}
+
+	if recommitInterval > cfg.BlockTime && cfg.BlockTime > 0 {
+		recommitInterval = cfg.BlockTime
+	}
+
+	return &Builder{
+		logger:           logger.Named("builder"),
+		blockchain:       b,
+		executor:         e,
+		txpool:           txp,
+		availSender:      availSender,
+		nodeType:         nodeType,
+		blockTime:        cfg.BlockTime,
+		recommitInterval: recommitInterval,
+		newTxCh:          make(chan struct{}, 1),
+	}
+}
+
+// NotifyNewTransaction tells the builder that a transaction which could
+// improve the in-flight block just landed in the txpool. It's safe to call
+// from any goroutine, including outside of a Build call; the signal is
+// simply dropped if nobody is listening.
+func (b *Builder) NotifyNewTransaction() {
+	select {
+	case b.newTxCh <- struct{}{}:
+	default:
+	}
+}
+
+// Build produces, seals and submits the next block on top of parent,
+// recommitting against the txpool until the deadline (parent time +
+// blockTime) is reached or the pool runs dry.
+func (b *Builder) Build(myAccount accounts.Account, signKey *keystore.Key, parent *types.Header) error {
+	header, gasLimit, err := b.buildHeader(myAccount, parent)
+	if err != nil {
+		return err
+	}
+
+	transition, txns, err := b.recommitUntilDeadline(myAccount, header, parent)
+	if err != nil {
+		return err
+	}
+
+	blk := b.assembleBlock(header, transition, txns)
+
+	blk, err = b.sealBlock(signKey, blk)
+	if err != nil {
+		return err
+	}
+
+	return b.submit(blk, gasLimit)
+}
+
+// recommitUntilDeadline runs the initial recommit and then keeps rebuilding
+// header/parent's transition - on a timer or on an explicit "better tx"
+// signal - until the slot deadline passes or the txpool drains.
+func (b *Builder) recommitUntilDeadline(myAccount accounts.Account, header *types.Header, parent *types.Header) (*state.Transition, []*types.Transaction, error) {
+	parentTime := time.Unix(int64(parent.Timestamp), 0)
+	deadline := parentTime.Add(b.blockTime)
+	if deadline.Before(time.Now()) {
+		deadline = time.Now()
+	}
+
+	transition, txns, err := b.recommit(myAccount, header, parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ticker := time.NewTicker(b.recommitInterval)
+	defer ticker.Stop()
+
+recommitLoop:
+	for {
+		if b.txpool.Length() == 0 {
+			break
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+			transition, txns, err = b.recommit(myAccount, header, parent)
+			if err != nil {
+				return nil, nil, err
+			}
+		case <-b.newTxCh:
+			transition, txns, err = b.recommit(myAccount, header, parent)
+			if err != nil {
+				return nil, nil, err
+			}
+		case <-time.After(wait):
+			break recommitLoop
+		}
+	}
+
+	return transition, txns, nil
+}
+
+// submit adapts the recommit interval based on how full blk ended up,
+// sends it to Avail, persists it locally and resets the txpool.
+func (b *Builder) submit(blk *types.Block, gasLimit uint64) error {
+	b.adaptRecommitInterval(blk.Header.GasUsed, gasLimit)
+
+	b.logger.Info("sending block to avail")
+
+	if err := b.availSender.SendAndWaitForStatus(blk, stypes.ExtrinsicStatus{IsInBlock: true}); err != nil {
+		b.logger.Error("error while submitting data to avail", "error", err)
+		return err
+	}
+
+	b.logger.Info("sent block to avail")
+	b.logger.Info("writing block to blockchain")
+
+	if err := b.blockchain.WriteBlock(blk, b.nodeType); err != nil {
+		return err
+	}
+
+	b.logger.Info("successfully wrote block to blockchain", "number", blk.Number(), "hash", blk.Hash(), "parent_hash", blk.ParentHash())
+
+	// After the block has been written we reset the txpool so that the old
+	// transactions are removed.
+	b.txpool.ResetWithHeaders(blk.Header)
+
+	return nil
+}
+
+// buildHeader sets up the header skeleton shared by every recommit attempt
+// within a single Build call; only the state root / gas used change between
+// recommits.
+func (b *Builder) buildHeader(myAccount accounts.Account, parent *types.Header) (*types.Header, uint64, error) {
+	header := &types.Header{
+		ParentHash: parent.Hash,
+		Number:     parent.Number + 1,
+		Miner:      myAccount.Address.Bytes(),
+		Nonce:      types.Nonce{},
+		GasLimit:   parent.GasLimit,
+		Timestamp:  uint64(time.Now().Unix()),
+	}
+
+	gasLimit, err := b.blockchain.CalculateGasLimit(header.Number)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header.GasLimit = gasLimit
+
+	parentTime := time.Unix(int64(parent.Timestamp), 0)
+	headerTime := parentTime.Add(b.blockTime)
+
+	if headerTime.Before(time.Now()) {
+		headerTime = time.Now()
+	}
+
+	header.Timestamp = uint64(headerTime.Unix())
+
+	if err := block.AssignExtraValidators(header, []types.Address{types.StringToAddress(myAccount.Address.Hex())}); err != nil {
+		return nil, 0, err
+	}
+
+	return header, gasLimit, nil
+}
+
+// recommit discards any in-flight transition and re-executes the current
+// best-fee-ordered set of transactions from the pool against a fresh
+// transition rooted at parent.
+func (b *Builder) recommit(myAccount accounts.Account, header *types.Header, parent *types.Header) (*state.Transition, []*types.Transaction, error) {
+	transition, err := b.executor.BeginTxn(parent.StateRoot, header, types.StringToAddress(myAccount.Address.Hex()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txns := b.writeTransactions(header.GasLimit, transition)
+
+	return transition, txns, nil
+}
+
+func (b *Builder) writeTransactions(gasLimit uint64, transition transitionInterface) []*types.Transaction {
+	b.txpoolMu.Lock()
+	defer b.txpoolMu.Unlock()
+
+	var successful []*types.Transaction
+
+	b.txpool.Prepare()
+
+	for {
+		tx := b.txpool.Peek()
+		if tx == nil {
+			break
+		}
+
+		b.logger.Debug("found transaction from txpool", "hash", tx.Hash.String())
+
+		if tx.ExceedsBlockGasLimit(gasLimit) {
+			b.txpool.Drop(tx)
+			continue
+		}
+
+		if err := transition.Write(tx); err != nil {
+			if _, ok := err.(*state.GasLimitReachedTransitionApplicationError); ok { // nolint:errorlint
+				b.logger.Warn("transaction reached gas limit during excution", "hash", tx.Hash.String())
+				break
+			} else if appErr, ok := err.(*state.TransitionApplicationError); ok && appErr.IsRecoverable { // nolint:errorlint
+				b.logger.Warn("transaction caused application error", "hash", tx.Hash.String())
+				b.txpool.Demote(tx)
+			} else {
+				b.logger.Error("transaction caused unknown error", "error", err)
+				b.txpool.Drop(tx)
+			}
+
+			continue
+		}
+
+		b.txpool.Pop(tx)
+
+		successful = append(successful, tx)
+	}
+
+	return successful
+}
+
+// peekTransactions is the non-mutating counterpart to writeTransactions,
+// built for preview-only callers (PayloadBuilder.Preview) that must not
+// affect what the real builder later includes. It never calls Pop or Drop,
+// since those permanently remove a transaction from the live pool; every
+// transaction it walks, successful or not, is handed back to the pool via
+// Demote, so pool membership is unchanged once the preview is done.
+func (b *Builder) peekTransactions(gasLimit uint64, transition transitionInterface) []*types.Transaction {
+	b.txpoolMu.Lock()
+	defer b.txpoolMu.Unlock()
+
+	var successful []*types.Transaction
+
+	b.txpool.Prepare()
+
+	for i := 0; i < previewScanLimit; i++ {
+		tx := b.txpool.Peek()
+		if tx == nil {
+			break
+		}
+
+		if tx.ExceedsBlockGasLimit(gasLimit) {
+			b.txpool.Demote(tx)
+			continue
+		}
+
+		if err := transition.Write(tx); err != nil {
+			if _, ok := err.(*state.GasLimitReachedTransitionApplicationError); ok { // nolint:errorlint
+				b.txpool.Demote(tx)
+				break
+			}
+
+			b.txpool.Demote(tx)
+			continue
+		}
+
+		successful = append(successful, tx)
+		b.txpool.Demote(tx)
+	}
+
+	return successful
+}
+
+// assembleBlock commits the winning transition and builds the unsealed
+// block around it. This is the "execution payload" half of block
+// production: it has a state root and receipts, but no consensus seal yet.
+func (b *Builder) assembleBlock(header *types.Header, transition *state.Transition, txns []*types.Transaction) *types.Block {
+	_, root := transition.Commit()
+
+	header.StateRoot = root
+	header.GasUsed = transition.TotalGas()
+
+	return consensus.BuildBlock(consensus.BuildBlockParams{
+		Header:   header,
+		Txns:     txns,
+		Receipts: transition.Receipts(),
+	})
+}
+
+// sealBlock writes the consensus seal over an assembled block and
+// recomputes its hash.
+func (b *Builder) sealBlock(signKey *keystore.Key, blk *types.Block) (*types.Block, error) {
+	sealedHeader, err := block.WriteSeal(signKey.PrivateKey, blk.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal block: %w", err)
+	}
+
+	blk.Header = sealedHeader
+	blk.Header.ComputeHash()
+
+	return blk, nil
+}
+
+// adaptRecommitInterval grows or shrinks the recommit interval towards
+// targetGasUsageRatio, bounded by [minRecommitInterval, maxRecommitInterval]
+// and the configured blockTime.
+func (b *Builder) adaptRecommitInterval(gasUsed, gasLimit uint64) {
+	if gasLimit == 0 {
+		return
+	}
+
+	ratio := float64(gasUsed) / float64(gasLimit)
+	interval := b.recommitInterval
+
+	switch {
+	case ratio < targetGasUsageRatio:
+		interval = time.Duration(float64(interval) * 0.9)
+	case ratio > targetGasUsageRatio:
+		interval = time.Duration(float64(interval) * 1.1)
+	}
+
+	if interval < minRecommitInterval {
+		interval = minRecommitInterval
+	}
+
+	if interval > maxRecommitInterval {
+		interval = maxRecommitInterval
+	}
+
+	if b.blockTime > 0 && interval > b.blockTime {
+		interval = b.blockTime
+	}
+
+	if interval != b.recommitInterval {
+		b.logger.Debug("adjusted recommit interval", "ratio", ratio, "from", b.recommitInterval, "to", interval)
+		b.recommitInterval = interval
+	}
+}
@@ -0,0 +1,96 @@
+package builder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func newTestBuilder(blockTime, recommitInterval time.Duration) *Builder {
+	return New(hclog.NewNullLogger(), nil, nil, nil, nil, "sequencer", Config{
+		BlockTime:        blockTime,
+		RecommitInterval: recommitInterval,
+	})
+}
+
+func TestNewClampsRecommitIntervalToBlockTime(t *testing.T) {
+	b := newTestBuilder(1*time.Second, 3*time.Second)
+
+	if b.recommitInterval != 1*time.Second {
+		t.Fatalf("expected recommit interval clamped to block time, got %s", b.recommitInterval)
+	}
+}
+
+func TestNewDefaultsRecommitInterval(t *testing.T) {
+	b := newTestBuilder(10*time.Second, 0)
+
+	if b.recommitInterval != DefaultRecommitInterval {
+		t.Fatalf("expected default recommit interval, got %s", b.recommitInterval)
+	}
+}
+
+func TestAdaptRecommitIntervalShrinksWhenUnderTarget(t *testing.T) {
+	b := newTestBuilder(10*time.Second, 2*time.Second)
+
+	b.adaptRecommitInterval(10, 100)
+
+	if b.recommitInterval >= 2*time.Second {
+		t.Fatalf("expected interval to shrink below 2s, got %s", b.recommitInterval)
+	}
+}
+
+func TestAdaptRecommitIntervalGrowsWhenOverTarget(t *testing.T) {
+	b := newTestBuilder(10*time.Second, 2*time.Second)
+
+	b.adaptRecommitInterval(95, 100)
+
+	if b.recommitInterval <= 2*time.Second {
+		t.Fatalf("expected interval to grow above 2s, got %s", b.recommitInterval)
+	}
+}
+
+func TestAdaptRecommitIntervalRespectsBounds(t *testing.T) {
+	b := newTestBuilder(0, minRecommitInterval)
+	b.blockTime = 0
+
+	// Pushed repeatedly under target, the interval must never drop below
+	// the configured floor.
+	for i := 0; i < 50; i++ {
+		b.adaptRecommitInterval(0, 100)
+	}
+
+	if b.recommitInterval < minRecommitInterval {
+		t.Fatalf("expected interval floor of %s, got %s", minRecommitInterval, b.recommitInterval)
+	}
+
+	b.recommitInterval = maxRecommitInterval
+
+	for i := 0; i < 50; i++ {
+		b.adaptRecommitInterval(100, 100)
+	}
+
+	if b.recommitInterval > maxRecommitInterval {
+		t.Fatalf("expected interval ceiling of %s, got %s", maxRecommitInterval, b.recommitInterval)
+	}
+}
+
+func TestNotifyNewTransactionNonBlocking(t *testing.T) {
+	b := newTestBuilder(10*time.Second, time.Second)
+
+	// Buffered channel of size 1: the first notify is buffered, the second
+	// must not block even though nobody drained the first.
+	b.NotifyNewTransaction()
+	done := make(chan struct{})
+
+	go func() {
+		b.NotifyNewTransaction()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("NotifyNewTransaction blocked when channel was full")
+	}
+}
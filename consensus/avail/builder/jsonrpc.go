@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/0xPolygon/polygon-edge/types"
+)
+
+// EngineService exposes PayloadBuilder over JSON-RPC under the "avail"
+// namespace, mirroring the execution-layer Engine API (forkchoiceUpdatedV1 /
+// getPayloadV1 / newPayloadV1) closely enough that an external
+// sequencer/relayer can drive block production without embedding
+// avail-settlement. Register it on the polygon-edge JSON-RPC server the same
+// way the "eth"/"net"/"web3" services are registered.
+type EngineService struct {
+	pb *PayloadBuilder
+}
+
+// NewEngineService builds the JSON-RPC service for pb.
+func NewEngineService(pb *PayloadBuilder) *EngineService {
+	return &EngineService{pb: pb}
+}
+
+// ForkchoiceStateV1 mirrors the execution-layer ForkchoiceStateV1, reduced
+// to the one field avail-settlement actually uses: we have no notion of
+// safe/finalized heads distinct from the Avail finality tracked elsewhere.
+type ForkchoiceStateV1 struct {
+	HeadBlockHash types.Hash `json:"headBlockHash"`
+}
+
+// PayloadAttributesV1 mirrors the execution-layer PayloadAttributesV1.
+type PayloadAttributesV1 struct {
+	Timestamp             uint64        `json:"timestamp"`
+	SuggestedFeeRecipient types.Address `json:"suggestedFeeRecipient"`
+	ExtraData             []byte        `json:"extraData"`
+}
+
+// ForkchoiceUpdatedResultV1 mirrors the execution-layer response shape.
+type ForkchoiceUpdatedResultV1 struct {
+	PayloadStatus string     `json:"payloadStatus"`
+	PayloadID     *PayloadID `json:"payloadId,omitempty"`
+}
+
+// ForkchoiceUpdatedV1 starts building a payload on top of the requested
+// head, equivalent to calling BuildPayload directly, but reachable over
+// JSON-RPC as "avail_forkchoiceUpdatedV1".
+func (e *EngineService) ForkchoiceUpdatedV1(state ForkchoiceStateV1, attrs *PayloadAttributesV1) (*ForkchoiceUpdatedResultV1, error) {
+	if attrs == nil {
+		return &ForkchoiceUpdatedResultV1{PayloadStatus: "VALID"}, nil
+	}
+
+	id, err := e.pb.BuildPayload(state.HeadBlockHash, attrs.Timestamp, attrs.SuggestedFeeRecipient, attrs.ExtraData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start payload build: %w", err)
+	}
+
+	return &ForkchoiceUpdatedResultV1{PayloadStatus: "VALID", PayloadID: &id}, nil
+}
+
+// GetPayloadV1 collects a previously requested build, reachable over
+// JSON-RPC as "avail_getPayloadV1".
+func (e *EngineService) GetPayloadV1(id PayloadID) (*types.Block, error) {
+	return e.pb.GetPayload(id)
+}
+
+// PayloadStatusV1 mirrors the execution-layer response to newPayload.
+type PayloadStatusV1 struct {
+	Status string `json:"status"`
+}
+
+// NewPayloadV1 submits a previously retrieved payload for sealing, Avail
+// submission and local persistence, reachable over JSON-RPC as
+// "avail_newPayloadV1".
+func (e *EngineService) NewPayloadV1(blk *types.Block) (*PayloadStatusV1, error) {
+	if err := e.pb.SubmitPayload(blk); err != nil {
+		return &PayloadStatusV1{Status: "INVALID"}, err
+	}
+
+	return &PayloadStatusV1{Status: "VALID"}, nil
+}
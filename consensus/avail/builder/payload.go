@@ -0,0 +1,238 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/0xPolygon/polygon-edge/state"
+	"github.com/0xPolygon/polygon-edge/types"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+)
+
+// PayloadID identifies a single BuildPayload call, the way the
+// execution-layer Engine API identifies payloads.
+type PayloadID [8]byte
+
+func (id PayloadID) String() string {
+	return fmt.Sprintf("%x", [8]byte(id))
+}
+
+// computePayloadID derives a stable id from the build parameters, so a
+// repeated BuildPayload call for the same (parent, timestamp, feeRecipient,
+// extra) tuple returns the same id instead of starting a second build.
+func computePayloadID(parent types.Hash, timestamp uint64, feeRecipient types.Address, extra []byte) PayloadID {
+	h := sha256.New()
+	h.Write(parent.Bytes())
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], timestamp)
+	h.Write(ts[:])
+
+	h.Write(feeRecipient.Bytes())
+	h.Write(extra)
+
+	var id PayloadID
+	copy(id[:], h.Sum(nil))
+
+	return id
+}
+
+// job tracks one in-flight or completed BuildPayload call. The recommit
+// loop runs in the background and closes ready once the build is done;
+// GetPayload blocks on that.
+type job struct {
+	parent *types.Header
+	header *types.Header
+
+	ready chan struct{}
+
+	transition *state.Transition
+	txns       []*types.Transaction
+	err        error
+
+	assembleOnce sync.Once
+	assembled    *types.Block
+	receipts     []*types.Receipt
+}
+
+// PayloadBuilder exposes block assembly through an Engine-API-shaped
+// surface (BuildPayload / GetPayload / SubmitPayload) instead of the single
+// blocking Build call, so an external driver can ask for a block over
+// JSON-RPC without embedding avail-settlement, and so the assembly logic is
+// unit-testable without an Avail stream.
+type PayloadBuilder struct {
+	*Builder
+
+	account accounts.Account
+	signKey *keystore.Key
+
+	mu   sync.Mutex
+	jobs map[PayloadID]*job
+}
+
+// NewPayloadBuilder wraps b with the Engine-style surface, signing any
+// payload it submits with signKey on behalf of account.
+func NewPayloadBuilder(b *Builder, account accounts.Account, signKey *keystore.Key) *PayloadBuilder {
+	return &PayloadBuilder{
+		Builder: b,
+		account: account,
+		signKey: signKey,
+		jobs:    make(map[PayloadID]*job),
+	}
+}
+
+// BuildPayload starts assembling a block on top of parentHash, recommitting
+// against the txpool the same way Build does, and returns immediately with
+// an id that GetPayload can later be called with to collect the result.
+func (pb *PayloadBuilder) BuildPayload(parentHash types.Hash, timestamp uint64, feeRecipient types.Address, extra []byte) (PayloadID, error) {
+	parent, ok := pb.blockchain.GetHeaderByHash(parentHash)
+	if !ok {
+		return PayloadID{}, fmt.Errorf("unknown parent header %s", parentHash)
+	}
+
+	id := computePayloadID(parentHash, timestamp, feeRecipient, extra)
+
+	pb.mu.Lock()
+	if _, exists := pb.jobs[id]; exists {
+		pb.mu.Unlock()
+		return id, nil
+	}
+
+	j := &job{parent: parent, ready: make(chan struct{})}
+	pb.jobs[id] = j
+	pb.mu.Unlock()
+
+	header, _, err := pb.buildHeader(pb.account, parent)
+	if err != nil {
+		pb.mu.Lock()
+		delete(pb.jobs, id)
+		pb.mu.Unlock()
+
+		j.err = err
+		close(j.ready)
+
+		return PayloadID{}, err
+	}
+
+	header.Miner = feeRecipient.Bytes()
+	header.Timestamp = timestamp
+
+	if len(extra) > 0 {
+		header.ExtraData = extra
+	}
+
+	j.header = header
+
+	go pb.run(j)
+
+	return id, nil
+}
+
+// run executes the recommit loop for j in the background until the slot
+// deadline passes or the txpool drains, then signals ready.
+func (pb *PayloadBuilder) run(j *job) {
+	defer close(j.ready)
+
+	transition, txns, err := pb.recommitUntilDeadline(pb.account, j.header, j.parent)
+	if err != nil {
+		j.err = err
+		return
+	}
+
+	j.transition, j.txns = transition, txns
+}
+
+// Preview builds a one-shot, read-only snapshot of the block that would be
+// produced on top of parentHash right now: a single BeginTxn plus a single
+// non-mutating pass over the txpool (see peekTransactions), with no
+// recommit ticker and no deadline wait. Unlike BuildPayload/GetPayload, the
+// result is never cached as a job and nothing is sealed, sent to Avail or
+// written to the chain - this is purely for callers like Pending that want
+// a cheap look at "what's next" without contending with real block
+// production for the txpool.
+func (pb *PayloadBuilder) Preview(parentHash types.Hash) (*types.Block, []*types.Receipt, error) {
+	parent, ok := pb.blockchain.GetHeaderByHash(parentHash)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown parent header %s", parentHash)
+	}
+
+	header, gasLimit, err := pb.buildHeader(pb.account, parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transition, err := pb.executor.BeginTxn(parent.StateRoot, header, types.StringToAddress(pb.account.Address.Hex()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txns := pb.peekTransactions(gasLimit, transition)
+
+	blk := pb.assembleBlock(header, transition, txns)
+
+	return blk, transition.Receipts(), nil
+}
+
+// GetPayload blocks until the build identified by id is done and returns
+// the assembled, unsealed block. It does not submit anything; call
+// SubmitPayload once the caller is ready to finalize it.
+func (pb *PayloadBuilder) GetPayload(id PayloadID) (*types.Block, error) {
+	blk, _, err := pb.getPayload(id)
+	return blk, err
+}
+
+// GetPayloadWithReceipts is GetPayload plus the receipts produced while
+// executing the payload's transactions. It waits for the build and
+// assembles the block exactly as GetPayload does; nothing is sealed or
+// submitted.
+func (pb *PayloadBuilder) GetPayloadWithReceipts(id PayloadID) (*types.Block, []*types.Receipt, error) {
+	return pb.getPayload(id)
+}
+
+func (pb *PayloadBuilder) getPayload(id PayloadID) (*types.Block, []*types.Receipt, error) {
+	pb.mu.Lock()
+	j, ok := pb.jobs[id]
+	pb.mu.Unlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown payload %s", id)
+	}
+
+	<-j.ready
+
+	if j.err != nil {
+		return nil, nil, j.err
+	}
+
+	// assembleBlock commits the underlying transition, which must only
+	// happen once per job no matter how many times the caller asks for it.
+	j.assembleOnce.Do(func() {
+		j.assembled = pb.assembleBlock(j.header, j.transition, j.txns)
+		j.receipts = j.transition.Receipts()
+	})
+
+	return j.assembled, j.receipts, nil
+}
+
+// SubmitPayload seals blk, sends it to Avail and writes it to the local
+// blockchain, exactly as Build does once the recommit loop has settled on a
+// final set of transactions.
+func (pb *PayloadBuilder) SubmitPayload(blk *types.Block) error {
+	sealed, err := pb.sealBlock(pb.signKey, blk)
+	if err != nil {
+		return err
+	}
+
+	return pb.submit(sealed, sealed.Header.GasLimit)
+}
+
+// ForgetPayload drops a completed or abandoned build so its resources can
+// be garbage collected. Safe to call more than once.
+func (pb *PayloadBuilder) ForgetPayload(id PayloadID) {
+	pb.mu.Lock()
+	delete(pb.jobs, id)
+	pb.mu.Unlock()
+}
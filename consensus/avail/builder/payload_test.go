@@ -0,0 +1,31 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/0xPolygon/polygon-edge/types"
+)
+
+func TestComputePayloadIDIsDeterministic(t *testing.T) {
+	parent := types.StringToHash("0x1")
+	recipient := types.StringToAddress("0x2")
+
+	a := computePayloadID(parent, 100, recipient, []byte("extra"))
+	b := computePayloadID(parent, 100, recipient, []byte("extra"))
+
+	if a != b {
+		t.Fatalf("expected identical inputs to produce the same payload id, got %s != %s", a, b)
+	}
+}
+
+func TestComputePayloadIDDiffersOnTimestamp(t *testing.T) {
+	parent := types.StringToHash("0x1")
+	recipient := types.StringToAddress("0x2")
+
+	a := computePayloadID(parent, 100, recipient, nil)
+	b := computePayloadID(parent, 101, recipient, nil)
+
+	if a == b {
+		t.Fatalf("expected different timestamps to produce different payload ids")
+	}
+}
@@ -0,0 +1,290 @@
+package avail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/0xPolygon/polygon-edge/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+// LeaderElector decides which of the active, staked sequencers should
+// produce the block for a given slot. slot is the Avail block number the
+// network is currently reacting to, so every node evaluating the same slot
+// with the same sequencer set agrees on the same answer.
+type LeaderElector interface {
+	IsLeader(slot uint64, sequencers []types.Address, self types.Address) (bool, leader types.Address)
+}
+
+// HashAwareLeaderElector is an optional extension of LeaderElector for
+// strategies whose unpredictability depends on more than the slot number
+// alone. LeaderElector.IsLeader's signature, as specified, has no room for
+// the Avail block hash of the slot, which is what a VRF-style seed actually
+// needs to stay unpredictable ahead of time; implementations that care
+// about that (WeightedByStakeElector) implement this too, and callers that
+// can supply the hash (sequencer.go's Run loop) should prefer it over
+// IsLeader via a type assertion rather than silently dropping the hash.
+type HashAwareLeaderElector interface {
+	LeaderElector
+
+	IsLeaderForHash(slot uint64, availBlockHash types.Hash, sequencers []types.Address, self types.Address) (bool, leader types.Address)
+}
+
+// FirstInListElector reproduces the original, trivially-centralized
+// behaviour: whichever sequencer happens to be first in the randomized
+// querier's list produces every block, regardless of slot.
+type FirstInListElector struct{}
+
+// NewFirstInListElector builds the default elector, kept for backwards
+// compatibility with deployments that haven't opted into one of the
+// alternatives below.
+func NewFirstInListElector() *FirstInListElector {
+	return &FirstInListElector{}
+}
+
+func (e *FirstInListElector) IsLeader(_ uint64, sequencers []types.Address, self types.Address) (bool, types.Address) {
+	if len(sequencers) == 0 {
+		return false, types.Address{}
+	}
+
+	return bytes.Equal(sequencers[0].Bytes(), self.Bytes()), sequencers[0]
+}
+
+// RoundRobinElector cycles through sequencers in list order, one per slot,
+// instead of always picking the head of the list.
+type RoundRobinElector struct{}
+
+func NewRoundRobinElector() *RoundRobinElector {
+	return &RoundRobinElector{}
+}
+
+func (e *RoundRobinElector) IsLeader(slot uint64, sequencers []types.Address, self types.Address) (bool, types.Address) {
+	if len(sequencers) == 0 {
+		return false, types.Address{}
+	}
+
+	leader := sequencers[slot%uint64(len(sequencers))]
+
+	return bytes.Equal(leader.Bytes(), self.Bytes()), leader
+}
+
+// StakeWeigher reports how much a sequencer has staked. WeightedByStakeElector
+// uses it to bias leader selection towards sequencers with more at stake.
+type StakeWeigher interface {
+	StakeOf(addr types.Address) (*big.Int, error)
+}
+
+// WeightedByStakeElector picks the leader for a slot from a VRF-style hash
+// of the slot mapped over a stake-weighted interval: sequencers with a
+// larger staked balance occupy a proportionally wider slice of the
+// interval and are more likely to be selected.
+type WeightedByStakeElector struct {
+	logger  hclog.Logger
+	weigher StakeWeigher
+}
+
+// NewWeightedByStakeElector builds a WeightedByStakeElector that sources
+// stake balances from weigher, typically the staking contract.
+func NewWeightedByStakeElector(logger hclog.Logger, weigher StakeWeigher) *WeightedByStakeElector {
+	return &WeightedByStakeElector{
+		logger:  logger.Named("weighted_leader_elector"),
+		weigher: weigher,
+	}
+}
+
+// IsLeader implements the plain LeaderElector interface, which has no room
+// for the Avail block hash. It falls back to seeding on the slot number
+// alone, which makes the selection predictable from the stake table ahead
+// of time; callers that can supply the hash should call IsLeaderForHash
+// instead. See the HashAwareLeaderElector doc comment.
+func (e *WeightedByStakeElector) IsLeader(slot uint64, sequencers []types.Address, self types.Address) (bool, types.Address) {
+	leader := e.pick(slotSeed(slot), sequencers)
+	return bytes.Equal(leader.Bytes(), self.Bytes()), leader
+}
+
+// IsLeaderForHash is the VRF-style selection the request actually asked
+// for: the seed mixes in availBlockHash alongside the slot, so the winner
+// can't be predicted before that Avail block exists.
+func (e *WeightedByStakeElector) IsLeaderForHash(slot uint64, availBlockHash types.Hash, sequencers []types.Address, self types.Address) (bool, types.Address) {
+	leader := e.pick(hashSeed(slot, availBlockHash), sequencers)
+	return bytes.Equal(leader.Bytes(), self.Bytes()), leader
+}
+
+func (e *WeightedByStakeElector) pick(seed *big.Int, sequencers []types.Address) types.Address {
+	if len(sequencers) == 0 {
+		return types.Address{}
+	}
+
+	weights := make([]*big.Int, len(sequencers))
+	total := new(big.Int)
+
+	for i, seq := range sequencers {
+		stake, err := e.weigher.StakeOf(seq)
+		if err != nil || stake == nil || stake.Sign() <= 0 {
+			e.logger.Warn("failed to read stake; weighing sequencer minimally", "sequencer", seq.String(), "error", err)
+			stake = big.NewInt(1)
+		}
+
+		weights[i] = stake
+		total.Add(total, stake)
+	}
+
+	if total.Sign() == 0 {
+		return sequencers[0]
+	}
+
+	point := new(big.Int).Mod(seed, total)
+
+	running := new(big.Int)
+	for i, w := range weights {
+		running.Add(running, w)
+		if point.Cmp(running) < 0 {
+			return sequencers[i]
+		}
+	}
+
+	return sequencers[len(sequencers)-1]
+}
+
+// slotSeed derives a deterministic-per-slot pseudo-random integer used to
+// pick a point on the stake-weighted interval. It's the fallback used by
+// IsLeader, which has no access to the Avail block hash; prefer hashSeed
+// via IsLeaderForHash wherever the hash is available, since slot-only
+// seeding is predictable ahead of time.
+func slotSeed(slot uint64) *big.Int {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], slot)
+	sum := sha256.Sum256(buf[:])
+
+	return new(big.Int).SetBytes(sum[:])
+}
+
+// hashSeed derives the pseudo-random integer used to pick a point on the
+// stake-weighted interval from both the slot and the Avail block hash that
+// carried it, so the outcome can't be known before that block exists.
+func hashSeed(slot uint64, availBlockHash types.Hash) *big.Int {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], slot)
+
+	h := sha256.New()
+	h.Write(buf[:])
+	h.Write(availBlockHash.Bytes())
+
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// MultiLeaderElector allows the top-k ranked sequencers for a slot to each
+// produce a candidate block, instead of a single leader. The fraud
+// resolver / watchtower is expected to pick the canonical candidate, e.g.
+// by highest total fee.
+type MultiLeaderElector struct {
+	k       int
+	elector LeaderElector
+}
+
+// NewMultiLeaderElector wraps elector so that the top k sequencers it would
+// rank for a slot are all considered leaders, instead of only the first. A
+// non-positive k is clamped to 0, i.e. "nobody is ever a leader", rather
+// than being allowed through to panic later in IsLeader.
+func NewMultiLeaderElector(k int, elector LeaderElector) *MultiLeaderElector {
+	if k < 0 {
+		k = 0
+	}
+
+	return &MultiLeaderElector{k: k, elector: elector}
+}
+
+// rank repeatedly asks elector for a leader among whoever is left, so it
+// can be built from any single-leader LeaderElector without that elector
+// needing to know about "top-k" at all.
+func (e *MultiLeaderElector) rank(slot uint64, sequencers []types.Address) []types.Address {
+	return e.rankWith(sequencers, func(remaining []types.Address) types.Address {
+		_, leader := e.elector.IsLeader(slot, remaining, types.Address{})
+		return leader
+	})
+}
+
+// rankForHash is rank's hash-aware counterpart, used when the wrapped
+// elector implements HashAwareLeaderElector: without it, wrapping a
+// hash-aware elector like WeightedByStakeElector here would silently fall
+// back to slot-only (and therefore predictable) ranking.
+func (e *MultiLeaderElector) rankForHash(slot uint64, availBlockHash types.Hash, sequencers []types.Address) []types.Address {
+	hashAware, ok := e.elector.(HashAwareLeaderElector)
+	if !ok {
+		return e.rank(slot, sequencers)
+	}
+
+	return e.rankWith(sequencers, func(remaining []types.Address) types.Address {
+		_, leader := hashAware.IsLeaderForHash(slot, availBlockHash, remaining, types.Address{})
+		return leader
+	})
+}
+
+// rankWith drives the "repeatedly pick a leader among whoever is left"
+// elimination shared by rank and rankForHash; pick is the only part that
+// differs between the slot-only and hash-aware paths.
+func (e *MultiLeaderElector) rankWith(sequencers []types.Address, pick func(remaining []types.Address) types.Address) []types.Address {
+	remaining := append([]types.Address(nil), sequencers...)
+	ranked := make([]types.Address, 0, len(sequencers))
+
+	for len(remaining) > 0 {
+		leader := pick(remaining)
+		ranked = append(ranked, leader)
+		remaining = removeAddress(remaining, leader)
+	}
+
+	return ranked
+}
+
+func (e *MultiLeaderElector) IsLeader(slot uint64, sequencers []types.Address, self types.Address) (bool, types.Address) {
+	return e.topK(e.rank(slot, sequencers), self)
+}
+
+// IsLeaderForHash implements HashAwareLeaderElector, forwarding to the
+// wrapped elector's hash-aware ranking when it supports it so that
+// composing MultiLeaderElector over a hash-aware elector (e.g.
+// WeightedByStakeElector) doesn't silently degrade to predictable,
+// slot-only selection. See HashAwareLeaderElector's doc comment.
+func (e *MultiLeaderElector) IsLeaderForHash(slot uint64, availBlockHash types.Hash, sequencers []types.Address, self types.Address) (bool, types.Address) {
+	return e.topK(e.rankForHash(slot, availBlockHash, sequencers), self)
+}
+
+// topK reports whether self is among the top e.k entries of ranked.
+func (e *MultiLeaderElector) topK(ranked []types.Address, self types.Address) (bool, types.Address) {
+	k := e.k
+	if k < 0 {
+		// Defensive: NewMultiLeaderElector already clamps this, but a
+		// negative k here must never reach ranked[:k], which panics.
+		k = 0
+	}
+
+	if k > len(ranked) {
+		k = len(ranked)
+	}
+
+	for _, candidate := range ranked[:k] {
+		if bytes.Equal(candidate.Bytes(), self.Bytes()) {
+			return true, candidate
+		}
+	}
+
+	if k == 0 {
+		return false, types.Address{}
+	}
+
+	return false, ranked[0]
+}
+
+func removeAddress(addrs []types.Address, target types.Address) []types.Address {
+	out := addrs[:0]
+
+	for _, a := range addrs {
+		if !bytes.Equal(a.Bytes(), target.Bytes()) {
+			out = append(out, a)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,190 @@
+package avail
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/0xPolygon/polygon-edge/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+type fixedStakeWeigher map[types.Address]*big.Int
+
+func (w fixedStakeWeigher) StakeOf(addr types.Address) (*big.Int, error) {
+	return w[addr], nil
+}
+
+func TestWeightedByStakeElectorPickFavorsHigherStake(t *testing.T) {
+	a := types.StringToAddress("0x1")
+	b := types.StringToAddress("0x2")
+
+	weigher := fixedStakeWeigher{
+		a: big.NewInt(1),
+		b: big.NewInt(1_000_000),
+	}
+
+	e := NewWeightedByStakeElector(hclog.NewNullLogger(), weigher)
+
+	counts := map[types.Address]int{}
+
+	for slot := uint64(0); slot < 200; slot++ {
+		leader := e.pick(slotSeed(slot), []types.Address{a, b})
+		counts[leader]++
+	}
+
+	if counts[b] <= counts[a] {
+		t.Fatalf("expected the heavily-staked sequencer to win more often, got a=%d b=%d", counts[a], counts[b])
+	}
+}
+
+func TestWeightedByStakeElectorPickIsDeterministic(t *testing.T) {
+	a := types.StringToAddress("0x1")
+	b := types.StringToAddress("0x2")
+
+	weigher := fixedStakeWeigher{a: big.NewInt(3), b: big.NewInt(7)}
+	e := NewWeightedByStakeElector(hclog.NewNullLogger(), weigher)
+
+	seed := slotSeed(42)
+
+	first := e.pick(seed, []types.Address{a, b})
+	second := e.pick(seed, []types.Address{a, b})
+
+	if first != second {
+		t.Fatalf("expected the same seed to pick the same leader, got %s != %s", first, second)
+	}
+}
+
+func TestHashSeedDiffersByAvailBlockHash(t *testing.T) {
+	h1 := types.StringToHash("0x1")
+	h2 := types.StringToHash("0x2")
+
+	if hashSeed(1, h1).Cmp(hashSeed(1, h2)) == 0 {
+		t.Fatal("expected different Avail block hashes to produce different seeds for the same slot")
+	}
+}
+
+func TestIsLeaderForHashDiffersFromSlotOnlyIsLeader(t *testing.T) {
+	a := types.StringToAddress("0x1")
+	b := types.StringToAddress("0x2")
+	sequencers := []types.Address{a, b}
+
+	weigher := fixedStakeWeigher{a: big.NewInt(1), b: big.NewInt(1)}
+	e := NewWeightedByStakeElector(hclog.NewNullLogger(), weigher)
+
+	_, slotLeader := e.IsLeader(7, sequencers, types.Address{})
+
+	// Hunt for an Avail block hash that picks a different leader than the
+	// slot-only path would, to prove the hash actually influences the
+	// outcome rather than being silently ignored.
+	found := false
+
+	for i := byte(0); i < 255; i++ {
+		hash := types.Hash{}
+		hash[0] = i
+
+		_, hashLeader := e.IsLeaderForHash(7, hash, sequencers, types.Address{})
+		if hashLeader != slotLeader {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Fatal("expected at least one Avail block hash to change the selected leader versus slot-only seeding")
+	}
+}
+
+func TestMultiLeaderElectorClampsNegativeK(t *testing.T) {
+	e := NewMultiLeaderElector(-5, NewFirstInListElector())
+
+	if e.k != 0 {
+		t.Fatalf("expected a negative k to be clamped to 0, got %d", e.k)
+	}
+
+	a := types.StringToAddress("0x1")
+	isLeader, leader := e.IsLeader(0, []types.Address{a}, a)
+
+	if isLeader {
+		t.Fatal("expected a k-of-0 elector to never report a leader")
+	}
+
+	if leader != (types.Address{}) {
+		t.Fatalf("expected a k-of-0 elector to report the zero address, got %s", leader)
+	}
+}
+
+func TestMultiLeaderElectorTopK(t *testing.T) {
+	a := types.StringToAddress("0x1")
+	b := types.StringToAddress("0x2")
+	c := types.StringToAddress("0x3")
+
+	e := NewMultiLeaderElector(2, NewRoundRobinElector())
+
+	isLeaderA, _ := e.IsLeader(0, []types.Address{a, b, c}, a)
+	isLeaderC, _ := e.IsLeader(0, []types.Address{a, b, c}, c)
+
+	if !isLeaderA {
+		t.Fatal("expected the round-robin head of slot 0 to be among the top 2")
+	}
+
+	ranked := e.rank(0, []types.Address{a, b, c})
+	if len(ranked) != 3 {
+		t.Fatalf("expected rank to order all 3 sequencers, got %d", len(ranked))
+	}
+
+	wantThird := ranked[2] == c
+	if isLeaderC && wantThird {
+		t.Fatal("expected the 3rd-ranked sequencer not to be a leader under k=2")
+	}
+}
+
+func TestMultiLeaderElectorForwardsToHashAwareWrappedElector(t *testing.T) {
+	a := types.StringToAddress("0x1")
+	b := types.StringToAddress("0x2")
+	sequencers := []types.Address{a, b}
+
+	weigher := fixedStakeWeigher{a: big.NewInt(1), b: big.NewInt(1)}
+	inner := NewWeightedByStakeElector(hclog.NewNullLogger(), weigher)
+	e := NewMultiLeaderElector(1, inner)
+
+	var hashAware HashAwareLeaderElector = e
+
+	_, slotLeader := e.IsLeader(7, sequencers, types.Address{})
+
+	// Hunt for an Avail block hash that picks a different top-1 leader than
+	// the slot-only path would, to prove IsLeaderForHash is actually
+	// forwarded to the wrapped elector rather than silently ignored.
+	found := false
+
+	for i := byte(0); i < 255; i++ {
+		hash := types.Hash{}
+		hash[0] = i
+
+		_, hashLeader := hashAware.IsLeaderForHash(7, hash, sequencers, types.Address{})
+		if hashLeader != slotLeader {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Fatal("expected at least one Avail block hash to change the selected leader versus slot-only ranking")
+	}
+}
+
+func TestMultiLeaderElectorFallsBackWithoutHashAwareWrappedElector(t *testing.T) {
+	e := NewMultiLeaderElector(2, NewRoundRobinElector())
+
+	var hashAware HashAwareLeaderElector = e
+
+	a := types.StringToAddress("0x1")
+	b := types.StringToAddress("0x2")
+	sequencers := []types.Address{a, b}
+
+	isLeader, leader := e.IsLeader(0, sequencers, a)
+	isLeaderForHash, leaderForHash := hashAware.IsLeaderForHash(0, types.StringToHash("0x1"), sequencers, a)
+
+	if isLeader != isLeaderForHash || leader != leaderForHash {
+		t.Fatal("expected IsLeaderForHash to fall back to slot-only ranking when the wrapped elector isn't hash-aware")
+	}
+}
@@ -1,53 +1,155 @@
 package avail
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/0xPolygon/polygon-edge/blockchain"
-	"github.com/0xPolygon/polygon-edge/consensus"
 	"github.com/0xPolygon/polygon-edge/state"
 	"github.com/0xPolygon/polygon-edge/txpool"
 	"github.com/0xPolygon/polygon-edge/types"
 	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
 	avail_types "github.com/centrifuge/go-substrate-rpc-client/v4/types"
-	stypes "github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/hashicorp/go-hclog"
+	"github.com/maticnetwork/avail-settlement/consensus/avail/builder"
 	"github.com/maticnetwork/avail-settlement/consensus/avail/validator"
 	"github.com/maticnetwork/avail-settlement/pkg/avail"
 	"github.com/maticnetwork/avail-settlement/pkg/block"
 	"github.com/maticnetwork/avail-settlement/pkg/staking"
 )
 
-type transitionInterface interface {
-	Write(txn *types.Transaction) error
-}
+// FinalizerFactory builds the Finalizer a SequencerWorker uses once its
+// Avail block stream is up and running. Threading it in as a factory,
+// rather than a ready-made Finalizer, lets callers choose between the
+// "N confirmations" and "GRANDPA proof" strategies (or a custom one) while
+// still letting the worker decide exactly when the underlying stream is
+// ready to be wrapped.
+type FinalizerFactory func(logger hclog.Logger, stream *avail.BlockStream) avail.Finalizer
 
 type SequencerWorker struct {
-	logger       hclog.Logger
-	blockchain   *blockchain.Blockchain
-	executor     *state.Executor
-	validator    validator.Validator
-	txpool       *txpool.TxPool
-	apq          staking.ActiveParticipants
-	availAppID   avail_types.U32
-	availClient  avail.Client
-	availAccount signature.KeyringPair
-	nodeSignKey  *ecdsa.PrivateKey
-	nodeAddr     types.Address
-	nodeType     MechanismType
-	stakingNode  staking.Node
-	availSender  avail.Sender
-	closeCh      chan struct{}
-	blockTime    time.Duration // Minimum block generation time in seconds
+	logger           hclog.Logger
+	blockchain       *blockchain.Blockchain
+	executor         *state.Executor
+	validator        validator.Validator
+	txpool           *txpool.TxPool
+	builder          *builder.Builder
+	payload          *builder.PayloadBuilder
+	leaderElector    LeaderElector
+	finalizerFactory FinalizerFactory
+	apq              staking.ActiveParticipants
+	availAppID       avail_types.U32
+	availClient      avail.Client
+	availAccount     signature.KeyringPair
+	nodeSignKey      *ecdsa.PrivateKey
+	nodeAddr         types.Address
+	nodeType         MechanismType
+	stakingNode      staking.Node
+	availSender      avail.Sender
+	closeCh          chan struct{}
+	blockTime        time.Duration // Minimum block generation time in seconds
+
+	// minConfirmations is how many Avail blocks must land on top of a block
+	// before we consider it final and persist what it contains. Zero means
+	// "finalize immediately", matching the old behaviour.
+	minConfirmations uint64
+
+	// pending holds Edge blocks decoded from Avail blocks that have been
+	// seen but not yet finalized, keyed by the Avail block hash that carried
+	// them. An entry is evicted either when its Avail block is finalized
+	// (and the Edge blocks become canonical) or when the finalizer reports
+	// it on Dropped because Avail reorg'd it away.
+	pending map[avail_types.Hash][]*types.Block
+
+	// engineService exposes payload's Build/Get/SubmitPayload trio over
+	// JSON-RPC, built alongside payload in Run. Guarded by pendingPreview's
+	// mutex along with payload itself; see setPayloadBuilder.
+	engineService *builder.EngineService
+
+	// pendingPreview caches the result of Pending(), see sequencer_pending.go.
+	// Its mutex also guards payload/engineService (see setPayloadBuilder),
+	// since both are written once by Run but may be read concurrently by an
+	// RPC-exposed Pending()/EngineService() call before or after that happens.
+	pendingPreview struct {
+		sync.Mutex
+		cache pendingCache
+	}
+}
+
+// setPayloadBuilder installs pb, and the EngineService built around it, as
+// the worker's payload builder, guarded against concurrent reads from
+// payloadBuilder/EngineService.
+func (sw *SequencerWorker) setPayloadBuilder(pb *builder.PayloadBuilder) {
+	sw.pendingPreview.Lock()
+	sw.payload = pb
+	sw.engineService = builder.NewEngineService(pb)
+	sw.pendingPreview.Unlock()
+}
+
+// payloadBuilder returns the current payload builder, safe to call
+// concurrently with Run's one-time assignment of it via setPayloadBuilder.
+func (sw *SequencerWorker) payloadBuilder() *builder.PayloadBuilder {
+	sw.pendingPreview.Lock()
+	defer sw.pendingPreview.Unlock()
+
+	return sw.payload
+}
+
+// EngineService returns the avail_forkchoiceUpdatedV1/avail_getPayloadV1/
+// avail_newPayloadV1 JSON-RPC handler for this sequencer, or nil before Run
+// has built one. The polygon-edge JSON-RPC server registers namespaces by
+// name the same way it already does for "eth"/"net"/"web3"; wire this one in
+// under "avail" there, e.g. via JSONRPCServices.
+func (sw *SequencerWorker) EngineService() *builder.EngineService {
+	sw.pendingPreview.Lock()
+	defer sw.pendingPreview.Unlock()
+
+	return sw.engineService
+}
+
+// JSONRPCServices returns the namespace -> service map the polygon-edge
+// JSON-RPC server's registration point expects, in the same shape "eth",
+// "net" and "web3" are registered with. Safe to call before Run starts; the
+// caller just gets an empty map until EngineService is ready.
+func (sw *SequencerWorker) JSONRPCServices() map[string]interface{} {
+	services := make(map[string]interface{})
+
+	if svc := sw.EngineService(); svc != nil {
+		services["avail"] = svc
+	}
+
+	return services
 }
 
 func (sw *SequencerWorker) Run(account accounts.Account, key *keystore.Key) error {
+	// The payload builder needs the signing identity up front; Run is a
+	// thin driver from here on, calling BuildPayload/GetPayload/SubmitPayload
+	// against it the same way an external sequencer would over JSON-RPC.
+	sw.setPayloadBuilder(builder.NewPayloadBuilder(sw.builder, account, key))
+
+	// Invalidate the cached pending preview (and nudge the in-flight
+	// builder's recommit loop) the moment the txpool promotes a
+	// transaction, instead of only on new Avail blocks; otherwise Pending()
+	// can keep serving a stale preview for an entire slot even though a
+	// better transaction just became eligible.
+	promoted := sw.txpool.SubscribeEvents(txpool.PROMOTED)
+	defer sw.txpool.UnsubscribeEvents(promoted)
+
+	go func() {
+		for {
+			select {
+			case <-promoted.GetEventCh():
+				sw.OnTransactionPromoted()
+			case <-sw.closeCh:
+				return
+			}
+		}
+	}()
+
 	t := new(atomic.Int64)
 	activeSequencersQuerier := staking.NewRandomizedActiveSequencersQuerier(t.Load, sw.apq)
 	validator := validator.New(sw.blockchain, sw.executor, sw.nodeAddr)
@@ -71,13 +173,40 @@ func (sw *SequencerWorker) Run(account accounts.Account, key *keystore.Key) erro
 	// BlockStream watcher must be started after the staking is done. Otherwise
 	// the stream is out-of-sync.
 	availBlockStream := avail.NewBlockStream(sw.availClient, sw.logger, 0)
-	defer availBlockStream.Close()
+
+	finalizer := sw.finalizerFactory(sw.logger, availBlockStream)
+	defer finalizer.Close()
+
+	sw.pending = make(map[avail_types.Hash][]*types.Block)
 
 	sw.logger.Info("Block stream successfully started.", "node_type", sw.nodeType)
 
 	for {
 		select {
-		case blk := <-availBlockStream.Chan():
+		case finalized := <-finalizer.Finalized():
+			// Only now do we persist what a (previously seen) Avail block
+			// carried, since it can no longer be reorg'd away.
+			availHash := finalized.Block.Header.Hash()
+
+			for _, blockk := range sw.pending[availHash] {
+				if err := sw.blockchain.WriteBlock(blockk, sw.nodeType.String()); err != nil {
+					sw.logger.Error("failed to write finalized block", "number", blockk.Number(), "error", err)
+				}
+			}
+
+			delete(sw.pending, availHash)
+			sw.invalidatePendingPreview()
+
+		case dropped := <-finalizer.Dropped():
+			// The Avail block that carried these speculative Edge blocks
+			// was reorg'd away before reaching finality; roll the
+			// speculative state back out instead of leaking it forever.
+			availHash := dropped.Block.Header.Hash()
+
+			delete(sw.pending, availHash)
+			sw.invalidatePendingPreview()
+
+		case blk := <-finalizer.Seen():
 			// Time `t` is [mostly] monotonic clock, backed by Avail. It's used for all
 			// time sensitive logic in sequencer, such as block generation timeouts.
 			t.Store(int64(blk.Block.Header.Number))
@@ -98,9 +227,12 @@ func (sw *SequencerWorker) Run(account accounts.Account, key *keystore.Key) erro
 				}
 			}
 
-			for _, blockk := range edgeBlks {
-				sw.blockchain.WriteBlock(blockk, sw.nodeType.String())
-			}
+			// Apply the decoded blocks to our speculative, pending view.
+			// They only become canonical (blockchain.WriteBlock) once the
+			// Avail block that carried them is finalized; if Avail reorgs
+			// this block away, finalizer.Dropped() tells us so above and we
+			// evict the entry instead of leaking it.
+			sw.pending[blk.Block.Header.Hash()] = edgeBlks
 
 			// Go through the blocks from avail and make sure to set fraud block in case it was discovered...
 			fraudResolver.CheckAndSetFraudBlock(edgeBlks)
@@ -139,16 +271,28 @@ func (sw *SequencerWorker) Run(account accounts.Account, key *keystore.Key) erro
 				panic("no staked sequencers")
 			}
 
-			// Is it my turn to generate next block?
-			if bytes.Equal(sequencers[0].Bytes(), sw.nodeAddr.Bytes()) {
+			// Is it my turn to generate next block? Prefer the hash-aware
+			// path when the configured elector supports it, since it's
+			// unpredictable ahead of time in a way that slot-only selection
+			// isn't; see HashAwareLeaderElector.
+			var isLeader bool
+			var leader types.Address
+
+			if hashAware, ok := sw.leaderElector.(HashAwareLeaderElector); ok {
+				availHash := blk.Block.Header.Hash()
+				isLeader, leader = hashAware.IsLeaderForHash(uint64(blk.Block.Header.Number), types.BytesToHash(availHash[:]), sequencers, sw.nodeAddr)
+			} else {
+				isLeader, leader = sw.leaderElector.IsLeader(uint64(blk.Block.Header.Number), sequencers, sw.nodeAddr)
+			}
+			if isLeader {
 				header := sw.blockchain.Header()
 				sw.logger.Info("it's my turn; producing a block", "t", blk.Block.Header.Number)
-				if err := sw.writeBlock(account, key, header); err != nil {
+				if err := sw.produceBlock(header); err != nil {
 					sw.logger.Error("failed to mine block", "err", err)
 				}
 				continue
 			} else {
-				sw.logger.Info("it's not my turn; skippin' a round", "t", blk.Block.Header.Number)
+				sw.logger.Info("it's not my turn; skippin' a round", "t", blk.Block.Header.Number, "leader", leader.String())
 			}
 
 		case <-sw.closeCh:
@@ -161,170 +305,83 @@ func (sw *SequencerWorker) Run(account accounts.Account, key *keystore.Key) erro
 	}
 }
 
-// writeNewBLock generates a new block based on transactions from the pool,
-// and writes them to the blockchain
-func (sw *SequencerWorker) writeBlock(myAccount accounts.Account, signKey *keystore.Key, parent *types.Header) error {
-	header := &types.Header{
-		ParentHash: parent.Hash,
-		Number:     parent.Number + 1,
-		Miner:      myAccount.Address.Bytes(),
-		Nonce:      types.Nonce{},
-		GasLimit:   parent.GasLimit, // Inherit from parent for now, will need to adjust dynamically later.
-		Timestamp:  uint64(time.Now().Unix()),
-	}
-
-	// calculate gas limit based on parent header
-	gasLimit, err := sw.blockchain.CalculateGasLimit(header.Number)
-	if err != nil {
-		return err
-	}
-
-	header.GasLimit = gasLimit
-
-	// set the timestamp
-	parentTime := time.Unix(int64(parent.Timestamp), 0)
-	headerTime := parentTime.Add(sw.blockTime)
-
-	if headerTime.Before(time.Now()) {
-		headerTime = time.Now()
-	}
-
-	header.Timestamp = uint64(headerTime.Unix())
-
-	// we need to include in the extra field the current set of validators
-	err = block.AssignExtraValidators(header, ValidatorSet{types.StringToAddress(myAccount.Address.Hex())})
-	if err != nil {
-		return err
-	}
-
-	transition, err := sw.executor.BeginTxn(parent.StateRoot, header, types.StringToAddress(myAccount.Address.Hex()))
-	if err != nil {
-		return err
+// produceBlock drives the payload builder through its Engine-API-style
+// surface: request a build on top of parent, collect the result once it's
+// ready, then hand it back for sealing and submission. This is the same
+// sequence an external driver would follow over the avail_* JSON-RPC
+// methods registered by builder.EngineService.
+func (sw *SequencerWorker) produceBlock(parent *types.Header) error {
+	payload := sw.payloadBuilder()
+
+	// Keep at least blockTime between parent and child timestamps.
+	timestamp := time.Unix(int64(parent.Timestamp), 0).Add(sw.blockTime)
+	if timestamp.Before(time.Now()) {
+		timestamp = time.Now()
 	}
 
-	txns := sw.writeTransactions(gasLimit, transition)
-
-	// Commit the changes
-	_, root := transition.Commit()
-
-	// Update the header
-	header.StateRoot = root
-	header.GasUsed = transition.TotalGas()
-
-	// Build the actual block
-	// The header hash is computed inside buildBlock
-	blk := consensus.BuildBlock(consensus.BuildBlockParams{
-		Header:   header,
-		Txns:     txns,
-		Receipts: transition.Receipts(),
-	})
-
-	// write the seal of the block after all the fields are completed
-	header, err = block.WriteSeal(signKey.PrivateKey, blk.Header)
+	id, err := payload.BuildPayload(parent.Hash, uint64(timestamp.Unix()), sw.nodeAddr, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to build payload: %w", err)
 	}
 
-	//if header.Number == 5 {
-	//	header.ExtraData = []byte{1, 2, 3}
-	//}
-
-	// Corrupt miner -> fraud check.
-	//header.Miner = types.ZeroAddress.Bytes()
-
-	blk.Header = header
-
-	// compute the hash, this is only a provisional hash since the final one
-	// is sealed after all the committed seals
-	blk.Header.ComputeHash()
-
-	sw.logger.Info("sending block to avail")
-
-	err = sw.availSender.SendAndWaitForStatus(blk, stypes.ExtrinsicStatus{IsInBlock: true})
+	blk, err := payload.GetPayload(id)
 	if err != nil {
-		sw.logger.Error("Error while submitting data to avail", "error", err)
-		return err
+		return fmt.Errorf("failed to get payload: %w", err)
 	}
 
-	sw.logger.Info("sent block to avail")
-	sw.logger.Info("writing block to blockchain")
-
-	// Write the block to the blockchain
-	if err := sw.blockchain.WriteBlock(blk, sw.nodeType.String()); err != nil {
-		return err
+	if err := payload.SubmitPayload(blk); err != nil {
+		return fmt.Errorf("failed to submit payload: %w", err)
 	}
 
-	sw.logger.Info("Successfully wrote block to blockchain", "number", blk.Number(), "hash", blk.Hash(), "parent_hash", blk.ParentHash())
-
-	// after the block has been written we reset the txpool so that
-	// the old transactions are removed
-	sw.txpool.ResetWithHeaders(blk.Header)
+	payload.ForgetPayload(id)
 
 	return nil
 }
 
-func (sw *SequencerWorker) writeTransactions(gasLimit uint64, transition transitionInterface) []*types.Transaction {
-	var successful []*types.Transaction
-
-	sw.txpool.Prepare()
-
-	for {
-		tx := sw.txpool.Peek()
-		if tx == nil {
-			break
-		}
-
-		sw.logger.Debug("found transaction from txpool", "hash", tx.Hash.String())
-
-		if tx.ExceedsBlockGasLimit(gasLimit) {
-			sw.txpool.Drop(tx)
-			continue
-		}
-
-		if err := transition.Write(tx); err != nil {
-			if _, ok := err.(*state.GasLimitReachedTransitionApplicationError); ok { // nolint:errorlint
-				sw.logger.Warn("transaction reached gas limit during excution", "hash", tx.Hash.String())
-				break
-			} else if appErr, ok := err.(*state.TransitionApplicationError); ok && appErr.IsRecoverable { // nolint:errorlint
-				sw.logger.Warn("transaction caused application error", "hash", tx.Hash.String())
-				sw.txpool.Demote(tx)
-			} else {
-				sw.logger.Error("transaction caused unknown error", "error", err)
-				sw.txpool.Drop(tx)
-			}
-
-			continue
-		}
-
-		// no errors, pop the tx from the pool
-		sw.txpool.Pop(tx)
-
-		successful = append(successful, tx)
-	}
-
-	return successful
-}
-
 func NewSequencer(
 	logger hclog.Logger, b *blockchain.Blockchain, e *state.Executor, txp *txpool.TxPool, v validator.Validator, availClient avail.Client,
 	availAccount signature.KeyringPair, availAppID avail_types.U32,
 	nodeSignKey *ecdsa.PrivateKey, nodeAddr types.Address, nodeType MechanismType,
-	apq staking.ActiveParticipants, stakingNode staking.Node, availSender avail.Sender, closeCh <-chan struct{}, blockTime time.Duration) (*SequencerWorker, error) {
+	apq staking.ActiveParticipants, stakingNode staking.Node, availSender avail.Sender, closeCh <-chan struct{}, blockTime time.Duration,
+	recommitInterval time.Duration, minConfirmations uint64, leaderElector LeaderElector, finalizerFactory FinalizerFactory) (*SequencerWorker, error) {
+	if leaderElector == nil {
+		// Preserve the original, trivially-centralized behaviour for
+		// callers that don't opt into one of the alternative strategies.
+		leaderElector = NewFirstInListElector()
+	}
+
+	if finalizerFactory == nil {
+		// Default to the "N confirmations" strategy for callers that don't
+		// opt into GRANDPA-proof finality or a custom strategy. With
+		// minConfirmations of zero every block is finalized as soon as it's
+		// seen.
+		finalizerFactory = func(logger hclog.Logger, stream *avail.BlockStream) avail.Finalizer {
+			return avail.NewConfirmationFinalizer(logger, stream, minConfirmations)
+		}
+	}
+
 	return &SequencerWorker{
-		logger:       logger,
-		blockchain:   b,
-		executor:     e,
-		validator:    v,
-		txpool:       txp,
-		apq:          apq,
-		availAppID:   availAppID,
-		availClient:  availClient,
-		availAccount: availAccount,
-		nodeSignKey:  nodeSignKey,
-		nodeAddr:     nodeAddr,
-		nodeType:     nodeType,
-		stakingNode:  stakingNode,
-		availSender:  availSender,
-		blockTime:    blockTime,
+		logger:     logger,
+		blockchain: b,
+		executor:   e,
+		validator:  v,
+		txpool:     txp,
+		builder: builder.New(logger, b, e, txp, availSender, nodeType.String(), builder.Config{
+			BlockTime:        blockTime,
+			RecommitInterval: recommitInterval,
+		}),
+		leaderElector:    leaderElector,
+		finalizerFactory: finalizerFactory,
+		apq:              apq,
+		availAppID:       availAppID,
+		availClient:      availClient,
+		availAccount:     availAccount,
+		nodeSignKey:      nodeSignKey,
+		nodeAddr:         nodeAddr,
+		nodeType:         nodeType,
+		stakingNode:      stakingNode,
+		availSender:      availSender,
+		blockTime:        blockTime,
+		minConfirmations: minConfirmations,
 	}, nil
 }
@@ -0,0 +1,110 @@
+package avail
+
+import (
+	"fmt"
+
+	"github.com/0xPolygon/polygon-edge/types"
+)
+
+// PendingResult is what the RPC/fraud-tooling "pending" block accessor
+// returns: a block built on top of the current head that has not been
+// sealed, sent to Avail or written to the chain, plus the receipts
+// execution produced along the way.
+type PendingResult struct {
+	Block    *types.Block
+	Receipts []*types.Receipt
+}
+
+// PendingBlockProvider is satisfied by SequencerWorker and is what the
+// JSON-RPC server's eth_getBlockByNumber("pending") handler should depend
+// on, so a watchtower or validator node (which has no sequencer of its own)
+// simply doesn't register one.
+type PendingBlockProvider interface {
+	Pending() (*PendingResult, error)
+}
+
+// pendingCache is the cache-hit/miss decision behind Pending(), pulled out
+// on its own so it's testable without a blockchain/executor/txpool stack.
+type pendingCache struct {
+	head   types.Hash
+	result *PendingResult
+	stale  bool
+}
+
+// get returns the cached result for head, if it's still fresh.
+func (c *pendingCache) get(head types.Hash) (*PendingResult, bool) {
+	if c.stale || c.result == nil || c.head != head {
+		return nil, false
+	}
+
+	return c.result, true
+}
+
+// set stores a freshly built result as the cache for head.
+func (c *pendingCache) set(head types.Hash, result *PendingResult) {
+	c.head = head
+	c.result = result
+	c.stale = false
+}
+
+// invalidate drops the cached result, forcing the next get to miss
+// regardless of which head it's asked about.
+func (c *pendingCache) invalidate() {
+	c.stale = true
+}
+
+// Pending builds a preview of the block the sequencer would publish next,
+// using PayloadBuilder.Preview - a single, non-mutating pass over the
+// txpool rather than the full recommit-until-deadline loop real block
+// production uses, so a cache-miss call can't block the caller for up to
+// blockTime or pop/drop transactions out of the pool that the real builder
+// still depends on. The result is cached per head so repeated calls within
+// the same slot are cheap; it's invalidated by invalidatePendingPreview,
+// which Run calls on every new head import and, via OnTransactionPromoted,
+// on every txpool "promoted" event too.
+func (sw *SequencerWorker) Pending() (*PendingResult, error) {
+	head := sw.blockchain.Header()
+
+	sw.pendingPreview.Lock()
+	if result, ok := sw.pendingPreview.cache.get(head.Hash); ok {
+		sw.pendingPreview.Unlock()
+		return result, nil
+	}
+	sw.pendingPreview.Unlock()
+
+	payload := sw.payloadBuilder()
+	if payload == nil {
+		return nil, fmt.Errorf("pending block unavailable before the sequencer starts running")
+	}
+
+	blk, receipts, err := payload.Preview(head.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview pending block: %w", err)
+	}
+
+	result := &PendingResult{Block: blk, Receipts: receipts}
+
+	sw.pendingPreview.Lock()
+	sw.pendingPreview.cache.set(head.Hash, result)
+	sw.pendingPreview.Unlock()
+
+	return result, nil
+}
+
+// invalidatePendingPreview drops the cached Pending() result. Call it any
+// time the current head moves or the txpool promotes a transaction that
+// could change what the next pending block looks like.
+func (sw *SequencerWorker) invalidatePendingPreview() {
+	sw.pendingPreview.Lock()
+	sw.pendingPreview.cache.invalidate()
+	sw.pendingPreview.Unlock()
+}
+
+// OnTransactionPromoted is subscribed to the txpool's "promoted" event by
+// Run. It both invalidates the cached pending preview and lets the
+// in-flight builder recommit know a potentially better transaction just
+// became available.
+func (sw *SequencerWorker) OnTransactionPromoted() {
+	sw.invalidatePendingPreview()
+	sw.builder.NotifyNewTransaction()
+}
@@ -0,0 +1,55 @@
+package avail
+
+import (
+	"testing"
+
+	"github.com/0xPolygon/polygon-edge/types"
+)
+
+func TestPendingCacheMissesOnEmptyCache(t *testing.T) {
+	var c pendingCache
+
+	if _, ok := c.get(types.StringToHash("0x1")); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+}
+
+func TestPendingCacheHitsOnMatchingHead(t *testing.T) {
+	var c pendingCache
+
+	head := types.StringToHash("0x1")
+	result := &PendingResult{}
+
+	c.set(head, result)
+
+	got, ok := c.get(head)
+	if !ok {
+		t.Fatal("expected a hit for the head the cache was set with")
+	}
+
+	if got != result {
+		t.Fatal("expected the cached result to be returned as-is")
+	}
+}
+
+func TestPendingCacheMissesOnDifferentHead(t *testing.T) {
+	var c pendingCache
+
+	c.set(types.StringToHash("0x1"), &PendingResult{})
+
+	if _, ok := c.get(types.StringToHash("0x2")); ok {
+		t.Fatal("expected a miss for a head that doesn't match the cached one")
+	}
+}
+
+func TestPendingCacheMissesAfterInvalidate(t *testing.T) {
+	var c pendingCache
+
+	head := types.StringToHash("0x1")
+	c.set(head, &PendingResult{})
+	c.invalidate()
+
+	if _, ok := c.get(head); ok {
+		t.Fatal("expected a miss after invalidate, even for the same head")
+	}
+}
@@ -0,0 +1,257 @@
+package avail
+
+import (
+	"sync"
+
+	avail_types "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Finalizer wraps a BlockStream and splits its output into two channels:
+// Seen, which fires as soon as a block is observed (today's behaviour), and
+// Finalized, which only fires once the implementation considers the block
+// safe from an Avail-side reorg. This mirrors how bridging watchers (e.g.
+// Wormhole's EVM watcher) separate raw observation from finality.
+type Finalizer interface {
+	// Seen streams every Avail block exactly as BlockStream produces it.
+	Seen() <-chan avail_types.SignedBlock
+
+	// Finalized streams only blocks that have met the finality criteria.
+	// Blocks here are always emitted in height order.
+	Finalized() <-chan avail_types.SignedBlock
+
+	// Dropped streams blocks previously emitted on Seen that were then
+	// reorg'd away before reaching Finalized. Callers that keep speculative
+	// state keyed by Avail block hash (e.g. the sequencer's pending map)
+	// must subscribe to this and evict on it, or that state leaks forever.
+	Dropped() <-chan avail_types.SignedBlock
+
+	// Close tears down the underlying BlockStream and all three channels.
+	Close()
+}
+
+// ConfirmationFinalizer treats a block as final once it has minConfirmations
+// descendants in the Avail chain, i.e. the simplest possible finality rule
+// and the one used when no GRANDPA proof is required.
+type ConfirmationFinalizer struct {
+	logger           hclog.Logger
+	stream           *BlockStream
+	minConfirmations uint64
+
+	seenCh      chan avail_types.SignedBlock
+	finalizedCh chan avail_types.SignedBlock
+	droppedCh   chan avail_types.SignedBlock
+	closeCh     chan struct{}
+	closeOnce   sync.Once
+
+	// window holds blocks seen but not yet finalized, oldest first.
+	window []avail_types.SignedBlock
+}
+
+// NewConfirmationFinalizer starts watching stream and emitting blocks on
+// Finalized once minConfirmations further blocks have been seen on top of
+// them. A reorg that replaces a block still in the confirmation window is
+// detected by parent-hash mismatch; the stale window entries are emitted on
+// Dropped rather than finalized, so a caller keeping speculative state keyed
+// by their Avail block hash can roll it back.
+func NewConfirmationFinalizer(logger hclog.Logger, stream *BlockStream, minConfirmations uint64) *ConfirmationFinalizer {
+	f := &ConfirmationFinalizer{
+		logger:           logger.Named("confirmation_finalizer"),
+		stream:           stream,
+		minConfirmations: minConfirmations,
+		seenCh:           make(chan avail_types.SignedBlock, 16),
+		finalizedCh:      make(chan avail_types.SignedBlock, 16),
+		droppedCh:        make(chan avail_types.SignedBlock, 16),
+		closeCh:          make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+func (f *ConfirmationFinalizer) run() {
+	defer close(f.seenCh)
+	defer close(f.finalizedCh)
+	defer close(f.droppedCh)
+
+	for {
+		select {
+		case blk, ok := <-f.stream.Chan():
+			if !ok {
+				return
+			}
+
+			f.observe(blk)
+		case <-f.closeCh:
+			return
+		}
+	}
+}
+
+func (f *ConfirmationFinalizer) observe(blk avail_types.SignedBlock) {
+	f.seenCh <- blk
+
+	f.window = trimReorgedWindow(f.window, blk.Block.Header.ParentHash, f.droppedCh)
+
+	f.window = append(f.window, blk)
+
+	for uint64(len(f.window)) > f.minConfirmations {
+		finalized := f.window[0]
+		f.window = f.window[1:]
+		f.finalizedCh <- finalized
+	}
+}
+
+// trimReorgedWindow drops the tail of window that the new head (identified
+// by its parent hash) does not build on top of, emitting each dropped entry
+// on dropped in the order they're removed (youngest first). It's a free
+// function so the reorg/window logic is testable without a running
+// goroutine or channels.
+func trimReorgedWindow(window []avail_types.SignedBlock, parent avail_types.Hash, dropped chan<- avail_types.SignedBlock) []avail_types.SignedBlock {
+	for len(window) > 0 && window[len(window)-1].Block.Header.Hash() != parent {
+		stale := window[len(window)-1]
+		window = window[:len(window)-1]
+		dropped <- stale
+	}
+
+	return window
+}
+
+func (f *ConfirmationFinalizer) Seen() <-chan avail_types.SignedBlock {
+	return f.seenCh
+}
+
+func (f *ConfirmationFinalizer) Finalized() <-chan avail_types.SignedBlock {
+	return f.finalizedCh
+}
+
+func (f *ConfirmationFinalizer) Dropped() <-chan avail_types.SignedBlock {
+	return f.droppedCh
+}
+
+func (f *ConfirmationFinalizer) Close() {
+	f.closeOnce.Do(func() {
+		close(f.closeCh)
+		f.stream.Close()
+	})
+}
+
+// GRANDPAFinalizer treats a block as final only once Avail's GRANDPA
+// consensus has produced a proof for it (or a later block), queried via
+// chain_getFinalizedHead / grandpa_proveFinality. It buffers seen blocks
+// until the finalized head catches up to them.
+type GRANDPAFinalizer struct {
+	logger hclog.Logger
+	client Client
+	stream *BlockStream
+
+	seenCh      chan avail_types.SignedBlock
+	finalizedCh chan avail_types.SignedBlock
+	droppedCh   chan avail_types.SignedBlock
+	closeCh     chan struct{}
+	closeOnce   sync.Once
+
+	pending []avail_types.SignedBlock
+}
+
+// NewGRANDPAFinalizer starts watching stream, polling client for the
+// GRANDPA-finalized head every time a new block is seen, and releasing any
+// buffered blocks at or below that head on Finalized.
+func NewGRANDPAFinalizer(logger hclog.Logger, client Client, stream *BlockStream) *GRANDPAFinalizer {
+	f := &GRANDPAFinalizer{
+		logger:      logger.Named("grandpa_finalizer"),
+		client:      client,
+		stream:      stream,
+		seenCh:      make(chan avail_types.SignedBlock, 16),
+		finalizedCh: make(chan avail_types.SignedBlock, 16),
+		droppedCh:   make(chan avail_types.SignedBlock, 16),
+		closeCh:     make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+func (f *GRANDPAFinalizer) run() {
+	defer close(f.seenCh)
+	defer close(f.finalizedCh)
+	defer close(f.droppedCh)
+
+	for {
+		select {
+		case blk, ok := <-f.stream.Chan():
+			if !ok {
+				return
+			}
+
+			f.observe(blk)
+		case <-f.closeCh:
+			return
+		}
+	}
+}
+
+func (f *GRANDPAFinalizer) observe(blk avail_types.SignedBlock) {
+	f.seenCh <- blk
+
+	f.pending = trimReorgedWindow(f.pending, blk.Block.Header.ParentHash, f.droppedCh)
+	f.pending = append(f.pending, blk)
+
+	finalizedHash, err := f.client.RPC.Chain.GetFinalizedHead()
+	if err != nil {
+		f.logger.Error("failed to query GRANDPA finalized head", "error", err)
+		return
+	}
+
+	finalizedHeader, err := f.client.RPC.Chain.GetHeader(finalizedHash)
+	if err != nil {
+		f.logger.Error("failed to query GRANDPA finalized header", "error", err)
+		return
+	}
+
+	// f.pending is kept in height order (append-only above), and Finalized
+	// must be emitted in height order too. So we stop at the first entry
+	// that isn't finalized yet - whether because it's above the finalized
+	// head or because ProveFinality transiently errored - rather than
+	// resolving every entry independently; otherwise a later, higher block
+	// could reach Finalized before its still-pending lower ancestor.
+	var remaining []avail_types.SignedBlock
+
+	for i, pending := range f.pending {
+		if uint64(pending.Block.Header.Number) > uint64(finalizedHeader.Number) {
+			remaining = f.pending[i:]
+			break
+		}
+
+		if _, err := f.client.RPC.Grandpa.ProveFinality(uint32(pending.Block.Header.Number)); err != nil {
+			f.logger.Error("failed to prove GRANDPA finality", "number", pending.Block.Header.Number, "error", err)
+			remaining = f.pending[i:]
+			break
+		}
+
+		f.finalizedCh <- pending
+	}
+
+	f.pending = remaining
+}
+
+func (f *GRANDPAFinalizer) Seen() <-chan avail_types.SignedBlock {
+	return f.seenCh
+}
+
+func (f *GRANDPAFinalizer) Finalized() <-chan avail_types.SignedBlock {
+	return f.finalizedCh
+}
+
+func (f *GRANDPAFinalizer) Dropped() <-chan avail_types.SignedBlock {
+	return f.droppedCh
+}
+
+func (f *GRANDPAFinalizer) Close() {
+	f.closeOnce.Do(func() {
+		close(f.closeCh)
+		f.stream.Close()
+	})
+}
@@ -0,0 +1,71 @@
+package avail
+
+import (
+	"testing"
+
+	avail_types "github.com/centrifuge/go-substrate-rpc-client/v4/types"
+)
+
+func signedBlockWithParent(parent avail_types.Hash) avail_types.SignedBlock {
+	var blk avail_types.SignedBlock
+	blk.Block.Header.ParentHash = parent
+
+	return blk
+}
+
+func TestTrimReorgedWindowKeepsMatchingTail(t *testing.T) {
+	tail := signedBlockWithParent(avail_types.Hash{})
+	window := []avail_types.SignedBlock{tail}
+
+	dropped := make(chan avail_types.SignedBlock, 1)
+
+	got := trimReorgedWindow(window, tail.Block.Header.Hash(), dropped)
+
+	if len(got) != 1 {
+		t.Fatalf("expected the chained tail to survive, got %d entries", len(got))
+	}
+
+	select {
+	case <-dropped:
+		t.Fatal("expected nothing to be emitted on dropped when the window still chains")
+	default:
+	}
+}
+
+func TestTrimReorgedWindowDropsNonMatchingTail(t *testing.T) {
+	var unrelatedParent avail_types.Hash
+	unrelatedParent[0] = 0xFF
+
+	tail := signedBlockWithParent(avail_types.Hash{})
+	window := []avail_types.SignedBlock{tail}
+
+	dropped := make(chan avail_types.SignedBlock, 1)
+
+	got := trimReorgedWindow(window, unrelatedParent, dropped)
+
+	if len(got) != 0 {
+		t.Fatalf("expected the non-matching window to be fully trimmed, got %d entries", len(got))
+	}
+
+	select {
+	case <-dropped:
+	default:
+		t.Fatal("expected the trimmed entry to be emitted on dropped")
+	}
+}
+
+func TestTrimReorgedWindowNoopOnEmptyWindow(t *testing.T) {
+	dropped := make(chan avail_types.SignedBlock, 1)
+
+	got := trimReorgedWindow(nil, avail_types.Hash{}, dropped)
+
+	if len(got) != 0 {
+		t.Fatalf("expected an empty window to stay empty, got %d entries", len(got))
+	}
+
+	select {
+	case <-dropped:
+		t.Fatal("expected nothing to be emitted on dropped for an empty window")
+	default:
+	}
+}